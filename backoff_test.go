@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffDelayGrowsExponentially(t *testing.T) {
+	p := &Process{Program: Program{BackoffFactor: 2, BackoffMax: 1000}}
+
+	cases := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, 1 * time.Second},
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{3, 8 * time.Second},
+	}
+	for _, c := range cases {
+		if got := p.backoffDelay(c.attempt); got != c.want {
+			t.Errorf("attempt %d: got %v, want %v", c.attempt, got, c.want)
+		}
+	}
+}
+
+func TestBackoffDelayCapsAtBackoffMax(t *testing.T) {
+	p := &Process{Program: Program{BackoffFactor: 2, BackoffMax: 5}}
+
+	if got := p.backoffDelay(10); got != 5*time.Second {
+		t.Fatalf("got %v, want capped at 5s", got)
+	}
+}
+
+func TestBackoffDelayDefaultsWhenUnset(t *testing.T) {
+	p := &Process{} // BackoffFactor and BackoffMax left at their zero values
+
+	want := time.Duration(defaultBackoffFactor) * time.Second // attempt 1 at the default factor
+	if got := p.backoffDelay(1); got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
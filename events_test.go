@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestProcess(t *testing.T) *Process {
+	t.Helper()
+	return NewProcess(Program{Name: "evt", Command: "true", LogDir: t.TempDir()})
+}
+
+func TestSubscribePublishDelivery(t *testing.T) {
+	p := newTestProcess(t)
+	events, cancel := p.Subscribe()
+	defer cancel()
+
+	p.SetState(Running)
+
+	select {
+	case ev := <-events:
+		if ev.NewState != Running {
+			t.Fatalf("got NewState %v, want Running", ev.NewState)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+}
+
+func TestSubscribeCancelClosesChannel(t *testing.T) {
+	p := newTestProcess(t)
+	events, cancel := p.Subscribe()
+	cancel()
+
+	if _, ok := <-events; ok {
+		t.Fatal("expected channel to be closed after cancel")
+	}
+}
+
+func TestPublishDropsForSlowConsumer(t *testing.T) {
+	p := newTestProcess(t)
+	_, cancel := p.Subscribe() // never drained, simulating a slow consumer
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < eventBufferSize*4; i++ {
+			p.SetState(Running)
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("publish blocked on a full, undrained subscriber channel")
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"os/user"
+	"runtime"
+	"strconv"
+	"sync"
+	"syscall"
+)
+
+// Handle is an opaque reference to a child process started by an Execer.
+type Handle struct {
+	cmd *exec.Cmd
+}
+
+// Execer starts, signals and waits on a Program's child process. Factoring it out of
+// Process keeps the FSM free of exec/credential/rlimit plumbing and leaves room for
+// other backends (containers, a remote agent) later.
+type Execer interface {
+	Start(pg Program, stdout, stderr io.Writer) (*Handle, error)
+	Signal(h *Handle, sig os.Signal) error
+	Wait(h *Handle) <-chan error
+	Pid(h *Handle) int
+}
+
+// DefaultExecer is the Execer a Process uses unless one is set explicitly.
+var DefaultExecer Execer = &posixExecer{}
+
+// posixExecer runs the child with a plain fork+exec, applying Program's
+// User/Group, Umask, RLimits and OOMScoreAdj.
+type posixExecer struct {
+	// mu serializes the umask/rlimit critical section around Start, since both are
+	// process-wide state that briefly apply to more than the child being started.
+	mu sync.Mutex
+}
+
+// rlimitByName maps the RLimits config keys to syscall constants. "nproc" is
+// deliberately absent: Go's syscall package defines no RLIMIT_NPROC on any platform.
+var rlimitByName = map[string]int{
+	"nofile": syscall.RLIMIT_NOFILE,
+	"as":     syscall.RLIMIT_AS,
+	"core":   syscall.RLIMIT_CORE,
+	"cpu":    syscall.RLIMIT_CPU,
+	"fsize":  syscall.RLIMIT_FSIZE,
+	"data":   syscall.RLIMIT_DATA,
+	"stack":  syscall.RLIMIT_STACK,
+}
+
+func (e *posixExecer) Start(pg Program, stdout, stderr io.Writer) (*Handle, error) {
+	cmd := exec.Command("sh", "-c", pg.Command) // sh -c so Command can stay a plain string
+	cmd.Dir = pg.Dir
+	cmd.Env = append(os.Environ(), pg.Environ...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	cred, err := credentialFor(pg.User, pg.Group)
+	if err != nil {
+		return nil, err
+	}
+	if cred != nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Credential: cred}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	restoreUmask := applyUmask(pg.Umask)
+	defer restoreUmask()
+
+	restoreRLimits, err := applyRLimits(pg.RLimits)
+	defer restoreRLimits()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	if pg.OOMScoreAdj != 0 {
+		applyOOMScoreAdj(cmd.Process.Pid, pg.OOMScoreAdj)
+	}
+	return &Handle{cmd: cmd}, nil
+}
+
+func (e *posixExecer) Signal(h *Handle, sig os.Signal) error {
+	if h == nil || h.cmd.Process == nil {
+		return nil
+	}
+	return h.cmd.Process.Signal(sig)
+}
+
+func (e *posixExecer) Wait(h *Handle) <-chan error {
+	errC := make(chan error, 1)
+	go func() { errC <- h.cmd.Wait() }()
+	return errC
+}
+
+func (e *posixExecer) Pid(h *Handle) int {
+	if h == nil || h.cmd.Process == nil {
+		return 0
+	}
+	return h.cmd.Process.Pid
+}
+
+// credentialFor resolves User/Group names to a syscall.Credential, or returns nil if
+// neither is set. A Group without a User keeps the running uid.
+func credentialFor(userName, groupName string) (*syscall.Credential, error) {
+	if userName == "" && groupName == "" {
+		return nil, nil
+	}
+	cred := &syscall.Credential{Uid: uint32(os.Getuid())}
+	if userName != "" {
+		u, err := user.Lookup(userName)
+		if err != nil {
+			return nil, fmt.Errorf("lookup user %q: %w", userName, err)
+		}
+		uid, _ := strconv.Atoi(u.Uid)
+		cred.Uid = uint32(uid)
+		gid, _ := strconv.Atoi(u.Gid)
+		cred.Gid = uint32(gid)
+	}
+	if groupName != "" {
+		g, err := user.LookupGroup(groupName)
+		if err != nil {
+			return nil, fmt.Errorf("lookup group %q: %w", groupName, err)
+		}
+		gid, _ := strconv.Atoi(g.Gid)
+		cred.Gid = uint32(gid)
+	}
+	return cred, nil
+}
+
+// applyUmask sets the process umask for the Start critical section, returning a func
+// that restores the previous value.
+func applyUmask(umask int) func() {
+	if umask == 0 {
+		return func() {}
+	}
+	old := syscall.Umask(umask)
+	return func() { syscall.Umask(old) }
+}
+
+// applyRLimits sets the named rlimits (nofile, as, ...) for the Start critical
+// section; the forked child inherits them across exec. It always returns a func
+// restoring whatever limits it actually changed, even when it returns early with an
+// error -- the caller must run it unconditionally, or a bad RLimits entry permanently
+// mutates the supervisor's own process-wide limits.
+func applyRLimits(limits map[string]uint64) (func(), error) {
+	type saved struct {
+		resource int
+		limit    syscall.Rlimit
+	}
+	var restores []saved
+	restore := func() {
+		for _, s := range restores {
+			syscall.Setrlimit(s.resource, &s.limit)
+		}
+	}
+	for name, value := range limits {
+		resource, ok := rlimitByName[name]
+		if !ok {
+			return restore, fmt.Errorf("unknown rlimit %q", name)
+		}
+		var old syscall.Rlimit
+		if err := syscall.Getrlimit(resource, &old); err != nil {
+			return restore, fmt.Errorf("getrlimit %s: %w", name, err)
+		}
+		lim := syscall.Rlimit{Cur: value, Max: value}
+		if err := syscall.Setrlimit(resource, &lim); err != nil {
+			return restore, fmt.Errorf("setrlimit %s: %w", name, err)
+		}
+		restores = append(restores, saved{resource, old})
+	}
+	return restore, nil
+}
+
+// applyOOMScoreAdj writes /proc/<pid>/oom_score_adj; best-effort and a no-op outside Linux.
+func applyOOMScoreAdj(pid, score int) {
+	if runtime.GOOS != "linux" {
+		return
+	}
+	path := fmt.Sprintf("/proc/%d/oom_score_adj", pid)
+	if err := os.WriteFile(path, []byte(strconv.Itoa(score)), 0644); err != nil {
+		log.Println("oom_score_adj failed:", err)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestApplyRLimitsRestoresOnUnknownKey(t *testing.T) {
+	const resource = syscall.RLIMIT_NOFILE
+	var before syscall.Rlimit
+	if err := syscall.Getrlimit(resource, &before); err != nil {
+		t.Fatal(err)
+	}
+
+	restore, err := applyRLimits(map[string]uint64{
+		"nofile": before.Cur, // applies cleanly
+		"bogus":  1,          // unknown key: must fail without leaking the nofile change
+	})
+	if err == nil {
+		t.Fatal("expected an error for the unknown rlimit key")
+	}
+	restore()
+
+	var after syscall.Rlimit
+	if err := syscall.Getrlimit(resource, &after); err != nil {
+		t.Fatal(err)
+	}
+	if after.Cur != before.Cur || after.Max != before.Max {
+		t.Fatalf("rlimit not restored: before=%+v after=%+v", before, after)
+	}
+}
+
+func TestApplyRLimitsNoopRestoreOnSuccess(t *testing.T) {
+	const resource = syscall.RLIMIT_NOFILE
+	var before syscall.Rlimit
+	if err := syscall.Getrlimit(resource, &before); err != nil {
+		t.Fatal(err)
+	}
+
+	restore, err := applyRLimits(map[string]uint64{"nofile": before.Cur})
+	if err != nil {
+		t.Fatal(err)
+	}
+	restore()
+
+	var after syscall.Rlimit
+	if err := syscall.Getrlimit(resource, &after); err != nil {
+		t.Fatal(err)
+	}
+	if after.Cur != before.Cur || after.Max != before.Max {
+		t.Fatalf("rlimit not restored: before=%+v after=%+v", before, after)
+	}
+}
+
+func TestCredentialForNeitherSetReturnsNil(t *testing.T) {
+	cred, err := credentialFor("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cred != nil {
+		t.Fatalf("expected a nil credential, got %+v", cred)
+	}
+}
+
+func TestCredentialForGroupOnlyKeepsRunningUID(t *testing.T) {
+	cred, err := credentialFor("", "root")
+	if err != nil {
+		t.Skipf("no root group on this system: %v", err)
+	}
+	if cred.Uid != uint32(os.Getuid()) {
+		t.Fatalf("got Uid %d, want the running uid %d", cred.Uid, os.Getuid())
+	}
+	if cred.Gid != 0 {
+		t.Fatalf("got Gid %d, want 0 (root group)", cred.Gid)
+	}
+}
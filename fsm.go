@@ -15,15 +15,18 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"sync"
 	"syscall"
 	"time"
-
-	"github.com/codeskyblue/kexec"
 )
 
 type FSMState string
@@ -31,10 +34,17 @@ type FSMEvent string
 type FSMHandler func()
 
 type FSM struct {
-	mu       sync.Mutex
-	state    FSMState
+	mu       sync.Mutex // serializes handler dispatch in Operate
 	handlers map[FSMState]map[FSMEvent]FSMHandler
 
+	// stateMu guards state itself. It's separate from mu because handlers run with mu
+	// held and call SetState synchronously -- reusing mu there would deadlock since
+	// sync.Mutex isn't reentrant, but SetState is also called from background
+	// goroutines (Process's start/retry/stop loops) outside of any Operate call, so
+	// state still needs its own lock to be safe for concurrent State()/SetState() use.
+	stateMu sync.Mutex
+	state   FSMState
+
 	StateChange func(oldState, newState FSMState)
 }
 
@@ -51,14 +61,22 @@ func (f *FSM) AddHandler(state FSMState, event FSMEvent, hdlr FSMHandler) *FSM {
 }
 
 func (f *FSM) State() FSMState {
+	f.stateMu.Lock()
+	defer f.stateMu.Unlock()
 	return f.state
 }
 
 func (f *FSM) SetState(newState FSMState) {
+	f.stateMu.Lock()
+	oldState := f.state
+	f.state = newState
+	f.stateMu.Unlock()
+
+	// StateChange (and the publish it triggers) runs outside stateMu so a handler that
+	// calls back into State()/SetState() can't deadlock against itself.
 	if f.StateChange != nil {
-		f.StateChange(f.state, newState)
+		f.StateChange(oldState, newState)
 	}
-	f.state = newState
 }
 
 func (f *FSM) Operate(event FSMEvent) FSMState {
@@ -82,18 +100,48 @@ func NewFSM(initState FSMState) *FSM {
 	}
 }
 
-// Only 4 states now is enough, I think
 var (
+	Starting  = FSMState("starting") // aka Backoff, process has been exec'd but hasn't survived StartSeconds yet
 	Running   = FSMState("running")
 	Stopped   = FSMState("stopped")
 	Fatal     = FSMState("fatal")
 	RetryWait = FSMState("retry wait")
+	Exited    = FSMState("exited") // exited with a code listed in ExitCodes; not retried
 
 	StartEvent   = FSMEvent("start")
 	StopEvent    = FSMEvent("stop")
 	RestartEvent = FSMEvent("restart")
 )
 
+// Defaults used when a Program leaves the backoff, stop or log fields unset.
+const (
+	defaultBackoffBase   = 1 * time.Second
+	defaultBackoffFactor = 2.0
+	defaultBackoffMax    = 60 // seconds
+	defaultStopSignal    = "SIGTERM"
+	defaultStopTimeout   = 10 // seconds
+
+	defaultLogDir      = "logs"
+	defaultLogMaxBytes = 50 * 1024 * 1024 // 50MB, matches supervisord's default
+	defaultLogBackups  = 10
+)
+
+// Log stream names accepted by Process.Tail and Process.Stream.
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+var signalByName = map[string]syscall.Signal{
+	"SIGTERM": syscall.SIGTERM,
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGKILL": syscall.SIGKILL,
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+}
+
 type Program struct {
 	Name         string   `yaml:"name" json:"name"`
 	Command      string   `yaml:"command" json:"command"`
@@ -102,7 +150,39 @@ type Program struct {
 	AutoStart    bool     `yaml:"autostart" json:"autostart"` // change to *bool, which support unexpected
 	StartRetries int      `yaml:"startretries" json:"startretries"`
 	StartSeconds int      `yaml:"startsecs" json:"startsecs"`
-	// LogDir       string   `yaml:"logdir"`
+	// BackoffFactor and BackoffMax control the wait between retries: delay = min(BackoffMax, 1s * BackoffFactor^attempt)
+	BackoffFactor float64 `yaml:"backoff_factor" json:"backoff_factor"`
+	BackoffMax    int     `yaml:"backoff_max" json:"backoff_max"` // seconds
+	// StopSignal is one of SIGTERM/SIGINT/SIGQUIT/SIGKILL/SIGHUP/SIGUSR1/SIGUSR2, sent on stop before
+	// escalating to SIGKILL after StopTimeout seconds.
+	StopSignal  string `yaml:"stopsignal" json:"stopsignal"`
+	StopTimeout int    `yaml:"stoptimeout" json:"stoptimeout"` // seconds
+	// LogDir holds rotated stdout/stderr logs when StdoutLogfile/StderrLogfile aren't set.
+	LogDir                string `yaml:"logdir" json:"logdir"`
+	StdoutLogfile         string `yaml:"stdout_logfile" json:"stdout_logfile"`
+	StdoutLogfileMaxBytes int64  `yaml:"stdout_logfile_maxbytes" json:"stdout_logfile_maxbytes"`
+	StdoutLogfileBackups  int    `yaml:"stdout_logfile_backups" json:"stdout_logfile_backups"`
+	StderrLogfile         string `yaml:"stderr_logfile" json:"stderr_logfile"`
+	StderrLogfileMaxBytes int64  `yaml:"stderr_logfile_maxbytes" json:"stderr_logfile_maxbytes"`
+	StderrLogfileBackups  int    `yaml:"stderr_logfile_backups" json:"stderr_logfile_backups"`
+	// RedirectStderr merges the stderr stream into the stdout log, like supervisord.
+	RedirectStderr bool `yaml:"redirect_stderr" json:"redirect_stderr"`
+	// ExitCodes lists exit codes that are expected rather than failures: the process
+	// transitions to Exited instead of retrying. Defaults to []int{0} when empty.
+	ExitCodes []int `yaml:"exitcodes" json:"exitcodes"`
+	// DependsOn names programs in the same Group that must reach Running or Exited
+	// before this one is started.
+	DependsOn []string `yaml:"depends_on" json:"depends_on"`
+	// User/Group switch the child's uid/gid (via Execer), like su -c.
+	User  string `yaml:"user" json:"user"`
+	Group string `yaml:"group" json:"group"`
+	// Umask sets the child's file creation mask, e.g. 0022.
+	Umask int `yaml:"umask" json:"umask"`
+	// RLimits applies setrlimit(2) limits to the child, keyed by "nofile", "as",
+	// "core", "cpu", "fsize", "data" or "stack".
+	RLimits map[string]uint64 `yaml:"rlimits" json:"rlimits"`
+	// OOMScoreAdj adjusts /proc/<pid>/oom_score_adj on Linux; 0 leaves it untouched.
+	OOMScoreAdj int `yaml:"oom_score_adj" json:"oom_score_adj"`
 }
 
 func (p *Program) Check() error {
@@ -118,21 +198,237 @@ func (p *Program) Check() error {
 	return nil
 }
 
+// Event describes a single FSM transition of a Process, delivered to Subscribe()rs.
+type Event struct {
+	Name      string    `json:"name"` // Program.Name this event belongs to
+	Time      time.Time `json:"time"`
+	OldState  FSMState  `json:"old_state"`
+	NewState  FSMState  `json:"new_state"`
+	PID       int       `json:"pid"`
+	ExitError error     `json:"-"`
+}
+
+// eventBufferSize bounds the per-subscriber channel; a subscriber that falls behind
+// this far has events dropped rather than blocking the process.
+const eventBufferSize = 16
+
 type Process struct {
 	*FSM      `json:"-"`
 	Program   `json:"program"`
-	cmd       *kexec.KCommand
+	handle    *Handle
+	execer    Execer
 	stopC     chan syscall.Signal
 	retryLeft int
 	Status    string `json:"status"`
+
+	lastExitErr error
+	subsMu      sync.Mutex
+	subs        map[chan Event]struct{}
+
+	stdoutLog *RotatingWriter
+	stderrLog *RotatingWriter
+}
+
+func (p *Process) logDir() string {
+	if p.LogDir != "" {
+		return p.LogDir
+	}
+	return defaultLogDir
+}
+
+func (p *Process) stdoutLogPath() string {
+	if p.StdoutLogfile != "" {
+		return p.StdoutLogfile
+	}
+	return filepath.Join(p.logDir(), p.Name+"_stdout.log")
+}
+
+func (p *Process) stderrLogPath() string {
+	if p.RedirectStderr {
+		return p.stdoutLogPath()
+	}
+	if p.StderrLogfile != "" {
+		return p.StderrLogfile
+	}
+	return filepath.Join(p.logDir(), p.Name+"_stderr.log")
+}
+
+// setupLogs opens the rotating stdout/stderr log files for this Process.
+func (p *Process) setupLogs() error {
+	stdoutMax := p.StdoutLogfileMaxBytes
+	if stdoutMax <= 0 {
+		stdoutMax = defaultLogMaxBytes
+	}
+	stdoutBackups := p.StdoutLogfileBackups
+	if stdoutBackups <= 0 {
+		stdoutBackups = defaultLogBackups
+	}
+	stdoutLog, err := NewRotatingWriter(p.stdoutLogPath(), stdoutMax, stdoutBackups)
+	if err != nil {
+		return fmt.Errorf("open stdout log: %w", err)
+	}
+	p.stdoutLog = stdoutLog
+
+	if p.RedirectStderr {
+		p.stderrLog = stdoutLog
+		return nil
+	}
+	stderrMax := p.StderrLogfileMaxBytes
+	if stderrMax <= 0 {
+		stderrMax = defaultLogMaxBytes
+	}
+	stderrBackups := p.StderrLogfileBackups
+	if stderrBackups <= 0 {
+		stderrBackups = defaultLogBackups
+	}
+	stderrLog, err := NewRotatingWriter(p.stderrLogPath(), stderrMax, stderrBackups)
+	if err != nil {
+		return fmt.Errorf("open stderr log: %w", err)
+	}
+	p.stderrLog = stderrLog
+	return nil
+}
+
+func (p *Process) logWriter(stream string) *RotatingWriter {
+	switch stream {
+	case StreamStdout:
+		return p.stdoutLog
+	case StreamStderr:
+		return p.stderrLog
+	default:
+		return nil
+	}
+}
+
+// Tail returns up to the last n lines of the given stream ("stdout" or "stderr").
+func (p *Process) Tail(stream string, n int) ([]string, error) {
+	w := p.logWriter(stream)
+	if w == nil {
+		return nil, fmt.Errorf("unknown log stream %q", stream)
+	}
+	return w.Tail(n)
+}
+
+// streamOpenAtEnd opens path and seeks to its current end, returning the FileInfo
+// observed at open time so the caller can later detect rotation via os.SameFile.
+func streamOpenAtEnd(path string) (*os.File, os.FileInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, fi, nil
+}
+
+// Stream follows the given log stream, sending newly written bytes until ctx is done.
+func (p *Process) Stream(ctx context.Context, stream string) <-chan []byte {
+	ch := make(chan []byte)
+	w := p.logWriter(stream)
+	go func() {
+		defer close(ch)
+		if w == nil {
+			return
+		}
+		f, fi, err := streamOpenAtEnd(w.path)
+		if err != nil {
+			return
+		}
+		defer func() { f.Close() }()
+
+		buf := make([]byte, 32*1024)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+			n, err := f.Read(buf)
+			if n > 0 {
+				chunk := make([]byte, n)
+				copy(chunk, buf[:n])
+				select {
+				case ch <- chunk:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err != nil {
+				// RotatingWriter.rotate() removes and recreates the file at the same
+				// path; a bare retry would keep reading the orphaned old inode
+				// forever, so check for that and reopen.
+				if rfi, statErr := os.Stat(w.path); statErr == nil && !os.SameFile(fi, rfi) {
+					f.Close()
+					newF, newFi, openErr := streamOpenAtEnd(w.path)
+					if openErr != nil {
+						return
+					}
+					f, fi = newF, newFi
+					continue
+				}
+				select {
+				case <-time.After(200 * time.Millisecond):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ch
 }
 
-func (p *Process) buildCommand() *kexec.KCommand {
-	cmd := kexec.CommandString(p.Command) // Not tested here, I think it should work
-	// cmd := kexec.Command(p.Command[0], p.Command[1:]...)
-	cmd.Dir = p.Dir
-	cmd.Env = append(os.Environ(), p.Environ...)
-	return cmd
+// pid returns the PID of the currently managed child, or 0 if there isn't one.
+func (p *Process) pid() int {
+	if p.handle == nil {
+		return 0
+	}
+	return p.execer.Pid(p.handle)
+}
+
+// Subscribe returns a channel of lifecycle Events and a cancel func to stop receiving
+// them. Events are delivered non-blockingly: a subscriber that isn't keeping up has
+// events dropped rather than stalling the Process.
+func (p *Process) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, eventBufferSize)
+	p.subsMu.Lock()
+	p.subs[ch] = struct{}{}
+	p.subsMu.Unlock()
+
+	cancel := func() {
+		p.subsMu.Lock()
+		if _, ok := p.subs[ch]; ok {
+			delete(p.subs, ch)
+			close(ch)
+		}
+		p.subsMu.Unlock()
+	}
+	return ch, cancel
+}
+
+func (p *Process) publish(old, newState FSMState) {
+	ev := Event{
+		Name:      p.Name,
+		Time:      time.Now(),
+		OldState:  old,
+		NewState:  newState,
+		PID:       p.pid(),
+		ExitError: p.lastExitErr,
+	}
+	p.subsMu.Lock()
+	defer p.subsMu.Unlock()
+	for ch := range p.subs {
+		select {
+		case ch <- ev:
+		default: // slow consumer, drop
+		}
+	}
 }
 
 func (p *Process) waitNextRetry() {
@@ -142,53 +438,163 @@ func (p *Process) waitNextRetry() {
 		p.SetState(Fatal)
 		return
 	}
+	attempt := p.StartRetries - p.retryLeft
 	p.retryLeft -= 1
 	select {
-	case <-time.After(2 * time.Second): // TODO: need put it into Program
+	case <-time.After(p.backoffDelay(attempt)):
 		p.startCommand()
 	case <-p.stopC:
 		p.stopCommand()
 	}
 }
 
+// backoffDelay returns the wait before the given retry attempt (0-indexed),
+// growing exponentially from a 1 second base and capped at BackoffMax.
+func (p *Process) backoffDelay(attempt int) time.Duration {
+	factor := p.BackoffFactor
+	if factor <= 1 {
+		factor = defaultBackoffFactor
+	}
+	max := p.BackoffMax
+	if max <= 0 {
+		max = defaultBackoffMax
+	}
+	delay := float64(defaultBackoffBase) * math.Pow(factor, float64(attempt))
+	if capped := float64(max) * float64(time.Second); delay > capped {
+		delay = capped
+	}
+	return time.Duration(delay)
+}
+
 func (p *Process) stopCommand() {
-	if p.cmd == nil {
+	if p.handle == nil {
 		return
 	}
-	p.cmd.Terminate(syscall.SIGKILL)
-	p.cmd = nil
+	p.execer.Signal(p.handle, syscall.SIGKILL)
+	p.handle = nil
+	p.lastExitErr = nil
 	time.Sleep(200 * time.Millisecond)
 	p.SetState(Stopped)
 }
 
+// stopSignal returns the signal to send on a graceful stop, defaulting to SIGTERM.
+func (p *Process) stopSignal() syscall.Signal {
+	if sig, ok := signalByName[p.StopSignal]; ok {
+		return sig
+	}
+	return signalByName[defaultStopSignal]
+}
+
+// gracefulStop sends sig to the running child, waits up to StopTimeout for errC to fire,
+// and escalates to SIGKILL if the child hasn't exited by then.
+func (p *Process) gracefulStop(sig syscall.Signal, errC <-chan error) {
+	if p.handle == nil {
+		p.SetState(Stopped)
+		return
+	}
+	p.execer.Signal(p.handle, sig)
+	timeout := p.StopTimeout
+	if timeout <= 0 {
+		timeout = defaultStopTimeout
+	}
+	select {
+	case <-errC:
+	case <-time.After(time.Duration(timeout) * time.Second):
+		log.Println("stop timeout, escalating to SIGKILL:", p.Name)
+		p.execer.Signal(p.handle, syscall.SIGKILL)
+		<-errC
+	}
+	p.handle = nil
+	p.lastExitErr = nil
+	p.SetState(Stopped)
+}
+
+// isExpectedExit reports whether code is one of Program.ExitCodes, defaulting to
+// just 0 when the list is empty.
+func (p *Process) isExpectedExit(code int) bool {
+	codes := p.ExitCodes
+	if len(codes) == 0 {
+		codes = []int{0}
+	}
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// exitCode extracts the process exit code from the error delivered by Execer.Wait, if any.
+func exitCode(err error) (code int, ok bool) {
+	if err == nil {
+		return 0, true
+	}
+	if exitErr, isExit := err.(*exec.ExitError); isExit {
+		return exitErr.ExitCode(), true
+	}
+	return 0, false
+}
+
 func (p *Process) IsRunning() bool {
-	return p.State() == Running || p.State() == RetryWait
+	switch p.State() {
+	case Starting, Running, RetryWait:
+		return true
+	}
+	return false
 }
 
 func (p *Process) startCommand() {
 	p.stopCommand()
 	log.Println("start cmd:", p.Name, p.Command)
-	p.cmd = kexec.CommandString(p.Command)
-	p.cmd.Stdout = os.Stdout
 
-	p.SetState(Running)
+	var stdout io.Writer = os.Stdout
+	if p.stdoutLog != nil {
+		stdout = p.stdoutLog
+	}
+	var stderr io.Writer
+	if p.stderrLog != nil {
+		stderr = p.stderrLog
+	}
+
+	p.lastExitErr = nil
+	p.SetState(Starting)
+
+	handle, startErr := p.execer.Start(p.Program, stdout, stderr)
+	p.handle = handle
+
 	go func() {
-		errC := GoFunc(p.cmd.Run)
+		var errC <-chan error
+		if startErr != nil {
+			immediate := make(chan error, 1)
+			immediate <- startErr
+			errC = immediate
+		} else {
+			errC = p.execer.Wait(handle)
+		}
 		startTime := time.Now()
-		select {
-		case err := <-errC: //<-GoTimeoutFunc(time.Duration(p.StartSeconds)*time.Second, p.cmd.Run):
-			log.Println(err, time.Since(startTime))
-			if time.Since(startTime) < time.Duration(p.StartSeconds)*time.Second {
-				if p.retryLeft == p.StartRetries { // If first time quit so fast, just set to fatal
-					p.SetState(Fatal)
-					log.Println("Start change to fatal")
+		settledC := time.After(time.Duration(p.StartSeconds) * time.Second)
+		for {
+			select {
+			case err := <-errC:
+				log.Println(err, time.Since(startTime))
+				if code, ok := exitCode(err); ok && p.isExpectedExit(code) {
+					p.handle = nil
+					p.lastExitErr = nil
+					p.SetState(Exited)
 					return
 				}
+				p.lastExitErr = err
+				p.waitNextRetry()
+				return
+			case <-settledC:
+				settledC = nil // never select this branch again
+				p.retryLeft = p.StartRetries
+				p.SetState(Running)
+			case sig := <-p.stopC:
+				log.Println("recv stop command:", sig)
+				p.gracefulStop(sig, errC)
+				return
 			}
-			p.waitNextRetry()
-		case <-p.stopC:
-			log.Println("recv stop command")
-			p.stopCommand()
 		}
 	}()
 }
@@ -197,29 +603,43 @@ func NewProcess(pg Program) *Process {
 	pr := &Process{
 		FSM:       NewFSM(Stopped),
 		Program:   pg,
+		execer:    DefaultExecer,
 		stopC:     make(chan syscall.Signal),
 		retryLeft: pg.StartRetries,
 		Status:    string(Stopped),
+		subs:      make(map[chan Event]struct{}),
 	}
-	pr.StateChange = func(_, newStatus FSMState) {
+	pr.StateChange = func(old, newStatus FSMState) {
 		pr.Status = string(newStatus)
+		pr.publish(old, newStatus)
 	}
 	if pr.StartSeconds <= 0 {
 		pr.StartSeconds = 3
 	}
+	if err := pr.setupLogs(); err != nil {
+		log.Println("log setup failed:", pr.Name, err)
+	}
 
-	pr.AddHandler(Stopped, StartEvent, func() {
+	// Restarting from any settled state is a fresh run: reset retryLeft so a prior
+	// start's retries (possibly all of them, on the way to Exited or Fatal) don't
+	// carry over and cut the new run's backoff short.
+	restart := func() {
 		pr.retryLeft = pr.StartRetries
 		pr.startCommand()
-	})
-	pr.AddHandler(Fatal, StartEvent, pr.startCommand)
+	}
+	pr.AddHandler(Stopped, StartEvent, restart)
+	pr.AddHandler(Fatal, StartEvent, restart)
+	pr.AddHandler(Exited, StartEvent, restart)
 
-	pr.AddHandler(Running, StopEvent, func() {
+	sendStop := func() {
 		select {
-		case pr.stopC <- syscall.SIGTERM:
+		case pr.stopC <- pr.stopSignal():
 		case <-time.After(200 * time.Millisecond):
 		}
-	}).AddHandler(Running, RestartEvent, func() {
+	}
+	pr.AddHandler(Starting, StopEvent, sendStop)
+	pr.AddHandler(RetryWait, StopEvent, sendStop)
+	pr.AddHandler(Running, StopEvent, sendStop).AddHandler(Running, RestartEvent, func() {
 		go func() {
 			pr.Operate(StopEvent)
 			// TODO: start laterly
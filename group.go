@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Group owns an ordered set of Processes built from Program.DependsOn, and starts
+// or stops them in dependency order, e.g. redis -> worker -> web.
+type Group struct {
+	procs map[string]*Process
+	order []string // topologically sorted program names, dependencies first
+}
+
+// NewGroup builds a Group from the given programs. It returns an error if a program
+// depends on a name that isn't in the group, or if the dependencies form a cycle.
+func NewGroup(programs []Program) (*Group, error) {
+	procs := make(map[string]*Process, len(programs))
+	for _, pg := range programs {
+		procs[pg.Name] = NewProcess(pg)
+	}
+	order, err := topoSort(procs)
+	if err != nil {
+		return nil, err
+	}
+	return &Group{procs: procs, order: order}, nil
+}
+
+// topoSort orders program names so that every DependsOn entry comes before its
+// dependent, detecting cycles along the way.
+func topoSort(procs map[string]*Process) ([]string, error) {
+	const (
+		white = iota
+		gray
+		black
+	)
+	color := make(map[string]int, len(procs))
+	order := make([]string, 0, len(procs))
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch color[name] {
+		case black:
+			return nil
+		case gray:
+			return fmt.Errorf("dependency cycle involving %q", name)
+		}
+		proc, ok := procs[name]
+		if !ok {
+			return fmt.Errorf("unknown dependency %q", name)
+		}
+		color[name] = gray
+		for _, dep := range proc.DependsOn {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		color[name] = black
+		order = append(order, name)
+		return nil
+	}
+
+	names := make([]string, 0, len(procs))
+	for name := range procs {
+		names = append(names, name)
+	}
+	sort.Strings(names) // deterministic order among independent programs
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// Process returns the named process and whether it exists in the group.
+func (g *Group) Process(name string) (*Process, bool) {
+	proc, ok := g.procs[name]
+	return proc, ok
+}
+
+// Start starts programs in dependency order, waiting for each to reach Running or
+// Exited (satisfied for dependents) before starting the ones that depend on it.
+func (g *Group) Start() error {
+	for _, name := range g.order {
+		proc := g.procs[name]
+		proc.Operate(StartEvent)
+		if err := proc.waitSettled(); err != nil {
+			return fmt.Errorf("start %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Stop sends a stop to each program in reverse dependency order, so dependents are
+// told to stop before what they depend on. It does not wait for a program to reach
+// Stopped before stopping the next one.
+func (g *Group) Stop() {
+	for i := len(g.order) - 1; i >= 0; i-- {
+		g.procs[g.order[i]].Operate(StopEvent)
+	}
+}
+
+// waitSettled blocks until the process reaches Running or Exited (both count as
+// satisfied for dependents), or returns an error once it reaches Fatal.
+//
+// Subscribe comes first, before the initial state check: publish and Subscribe both
+// take subsMu, so once we're subscribed no transition can land unobserved between the
+// check and the subsequent read from events.
+func (p *Process) waitSettled() error {
+	events, cancel := p.Subscribe()
+	defer cancel()
+
+	switch p.State() {
+	case Running, Exited:
+		return nil
+	case Fatal:
+		return fmt.Errorf("%s: fatal", p.Name)
+	}
+
+	for ev := range events {
+		switch ev.NewState {
+		case Running, Exited:
+			return nil
+		case Fatal:
+			return fmt.Errorf("%s: fatal", p.Name)
+		}
+	}
+	return fmt.Errorf("%s: stopped settling before it became ready", p.Name)
+}
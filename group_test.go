@@ -0,0 +1,117 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTopoSortOrdersDependenciesFirst(t *testing.T) {
+	procs := map[string]*Process{
+		"web":    {Program: Program{Name: "web", DependsOn: []string{"worker"}}},
+		"worker": {Program: Program{Name: "worker", DependsOn: []string{"redis"}}},
+		"redis":  {Program: Program{Name: "redis"}},
+	}
+	order, err := topoSort(procs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pos := make(map[string]int, len(order))
+	for i, name := range order {
+		pos[name] = i
+	}
+	if pos["redis"] > pos["worker"] || pos["worker"] > pos["web"] {
+		t.Fatalf("expected redis < worker < web, got order %v", order)
+	}
+}
+
+func TestTopoSortDetectsCycle(t *testing.T) {
+	procs := map[string]*Process{
+		"a": {Program: Program{Name: "a", DependsOn: []string{"b"}}},
+		"b": {Program: Program{Name: "b", DependsOn: []string{"a"}}},
+	}
+	_, err := topoSort(procs)
+	if err == nil {
+		t.Fatal("expected a cycle error, got nil")
+	}
+	if !strings.Contains(err.Error(), "cycle") {
+		t.Fatalf("error should mention the cycle, got: %v", err)
+	}
+}
+
+func TestTopoSortRejectsUnknownDependency(t *testing.T) {
+	procs := map[string]*Process{
+		"a": {Program: Program{Name: "a", DependsOn: []string{"missing"}}},
+	}
+	if _, err := topoSort(procs); err == nil {
+		t.Fatal("expected an unknown-dependency error, got nil")
+	}
+}
+
+func TestWaitSettledReturnsImmediatelyWhenAlreadySettled(t *testing.T) {
+	p := NewProcess(Program{Name: "p", Command: "true", LogDir: t.TempDir()})
+	p.SetState(Running)
+
+	done := make(chan error, 1)
+	go func() { done <- p.waitSettled() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waitSettled blocked despite already being Running")
+	}
+}
+
+func TestWaitSettledUnblocksOnTransitionToRunning(t *testing.T) {
+	p := NewProcess(Program{Name: "p", Command: "true", LogDir: t.TempDir()})
+
+	done := make(chan error, 1)
+	go func() { done <- p.waitSettled() }()
+
+	time.Sleep(50 * time.Millisecond) // give waitSettled time to subscribe first
+	p.SetState(Running)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waitSettled never observed the transition to Running")
+	}
+}
+
+func TestWaitSettledReturnsErrorOnFatal(t *testing.T) {
+	p := NewProcess(Program{Name: "p", Command: "true", LogDir: t.TempDir()})
+	p.SetState(Fatal)
+
+	if err := p.waitSettled(); err == nil {
+		t.Fatal("expected an error once the process is Fatal")
+	}
+}
+
+func TestRestartFromExitedResetsRetryBudget(t *testing.T) {
+	p := NewProcess(Program{Name: "p", Command: "true", StartRetries: 3, LogDir: t.TempDir()})
+	p.retryLeft = 0 // simulate a prior run that consumed its whole retry budget
+	p.SetState(Exited)
+
+	p.Operate(StartEvent)
+
+	if p.retryLeft != p.StartRetries {
+		t.Fatalf("got retryLeft %d, want it reset to StartRetries (%d)", p.retryLeft, p.StartRetries)
+	}
+}
+
+func TestRestartFromFatalResetsRetryBudget(t *testing.T) {
+	p := NewProcess(Program{Name: "p", Command: "true", StartRetries: 3, LogDir: t.TempDir()})
+	p.retryLeft = 0
+	p.SetState(Fatal)
+
+	p.Operate(StartEvent)
+
+	if p.retryLeft != p.StartRetries {
+		t.Fatalf("got retryLeft %d, want it reset to StartRetries (%d)", p.retryLeft, p.StartRetries)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// RotatingWriter is an io.WriteCloser that rotates the underlying file before a write
+// would take it past MaxBytes, gzip-compressing up to Backups older generations (path.1.gz, path.2.gz, ...).
+type RotatingWriter struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	backups  int
+	file     *os.File
+	size     int64
+}
+
+// NewRotatingWriter opens (creating if needed) the log file at path, ready to append.
+func NewRotatingWriter(path string, maxBytes int64, backups int) (*RotatingWriter, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	w := &RotatingWriter{path: path, maxBytes: maxBytes, backups: backups}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *RotatingWriter) open() error {
+	f, err := os.OpenFile(w.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file = f
+	w.size = info.Size()
+	return nil
+}
+
+func (w *RotatingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.maxBytes > 0 && w.size+int64(len(p)) > w.maxBytes {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// rotate closes the current file, shifts path.N.gz -> path.(N+1).gz (dropping anything
+// past Backups), gzips the just-closed file into path.1.gz, and reopens path fresh.
+func (w *RotatingWriter) rotate() error {
+	if w.file != nil {
+		w.file.Close()
+	}
+	if w.backups > 0 {
+		os.Remove(w.backupPath(w.backups))
+		for i := w.backups - 1; i >= 1; i-- {
+			src := w.backupPath(i)
+			if _, err := os.Stat(src); err == nil {
+				os.Rename(src, w.backupPath(i+1))
+			}
+		}
+		if err := gzipFile(w.path, w.backupPath(1)); err != nil {
+			return err
+		}
+	}
+	os.Remove(w.path)
+	w.size = 0
+	return w.open()
+}
+
+func (w *RotatingWriter) backupPath(n int) string {
+	return fmt.Sprintf("%s.%d.gz", w.path, n)
+}
+
+func gzipFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func (w *RotatingWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	return w.file.Close()
+}
+
+// Tail returns up to the last n lines currently on disk.
+func (w *RotatingWriter) Tail(n int) ([]string, error) {
+	w.mu.Lock()
+	path := w.path
+	w.mu.Unlock()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+		if len(lines) > n {
+			lines = lines[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingWriterRotatesAndGzipsOldGeneration(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.log")
+	w, err := NewRotatingWriter(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	if _, err := w.Write([]byte("0123456789")); err != nil {
+		t.Fatal(err)
+	}
+	// Pushes size past maxBytes, so this write should rotate before landing.
+	if _, err := w.Write([]byte("next")); err != nil {
+		t.Fatal(err)
+	}
+
+	backup := path + ".1.gz"
+	f, err := os.Open(backup)
+	if err != nil {
+		t.Fatalf("expected rotated backup at %s: %v", backup, err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "0123456789" {
+		t.Fatalf("got %q, want %q", got, "0123456789")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "next" {
+		t.Fatalf("got %q, want %q", data, "next")
+	}
+}
+
+func TestRotatingWriterSkipsBackupsWhenDisabled(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.log")
+	w, err := NewRotatingWriter(path, 1, 0) // Backups=0: rotate but keep no history
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	for i := 0; i < 3; i++ {
+		if _, err := w.Write([]byte{'a' + byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := os.Stat(path + ".1.gz"); !os.IsNotExist(err) {
+		t.Fatalf("expected no backup files when Backups=0, got err=%v", err)
+	}
+}
+
+func TestRotatingWriterTail(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.log")
+	w, err := NewRotatingWriter(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	for _, line := range []string{"one", "two", "three", "four"} {
+		if _, err := w.Write([]byte(line + "\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := w.Tail(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"three", "four"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestStreamReopensAfterRotation(t *testing.T) {
+	p := NewProcess(Program{
+		Name:                  "s",
+		Command:               "true",
+		LogDir:                t.TempDir(),
+		StdoutLogfileMaxBytes: 12,
+		StdoutLogfileBackups:  2,
+	})
+	defer p.stdoutLog.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	chunks := p.Stream(ctx, StreamStdout)
+	time.Sleep(50 * time.Millisecond) // let Stream's goroutine open the file before we write
+
+	if _, err := p.stdoutLog.Write([]byte("before\n")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case chunk := <-chunks:
+		if string(chunk) != "before\n" {
+			t.Fatalf("got %q, want %q", chunk, "before\n")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the pre-rotation chunk")
+	}
+
+	if _, err := p.stdoutLog.Write([]byte("XXXXXX")); err != nil { // 7+6 > MaxBytes(12): forces a rotation
+		t.Fatal(err)
+	}
+	// Give Stream's poll loop (200ms cadence) time to notice the old inode is gone
+	// and reopen at the new file's current end, before we write the bytes it should see.
+	time.Sleep(500 * time.Millisecond)
+	if _, err := p.stdoutLog.Write([]byte("after\n")); err != nil { // 6+6 == MaxBytes(12): no further rotation
+		t.Fatal(err)
+	}
+
+	deadline := time.After(3 * time.Second)
+	var got strings.Builder
+	for {
+		select {
+		case chunk := <-chunks:
+			got.Write(chunk)
+			if strings.Contains(got.String(), "after\n") {
+				return
+			}
+		case <-deadline:
+			t.Fatalf("never saw post-rotation data, got %q", got.String())
+		}
+	}
+}
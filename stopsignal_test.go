@@ -0,0 +1,27 @@
+package main
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestStopSignalDefaultsToSIGTERM(t *testing.T) {
+	p := &Process{}
+	if got := p.stopSignal(); got != syscall.SIGTERM {
+		t.Fatalf("got %v, want SIGTERM", got)
+	}
+}
+
+func TestStopSignalUsesConfiguredValue(t *testing.T) {
+	p := &Process{Program: Program{StopSignal: "SIGINT"}}
+	if got := p.stopSignal(); got != syscall.SIGINT {
+		t.Fatalf("got %v, want SIGINT", got)
+	}
+}
+
+func TestStopSignalFallsBackOnUnknownName(t *testing.T) {
+	p := &Process{Program: Program{StopSignal: "SIGBOGUS"}}
+	if got := p.stopSignal(); got != syscall.SIGTERM {
+		t.Fatalf("got %v, want SIGTERM fallback", got)
+	}
+}